@@ -1,11 +1,10 @@
 package cmd
 
 import (
-	"bytes"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
-	"net/http"
+	neturl "net/url"
 	"os"
 	"os/signal"
 	"strings"
@@ -24,8 +23,69 @@ import (
 var protocolCount = 0
 var stdoutLogging = false
 
+// activeListener tracks one running protocol listener so that SIGHUP
+// reloads (see reload.go) can diff the desired configuration against what
+// is actually bound and tear down only what changed.
+type activeListener struct {
+	proto    string
+	port     int
+	shutdown func()
+}
+
+var listenersMu sync.Mutex
+var listeners = []activeListener{}
+
+// outputsMu guards rw.OutputWriters/rw.OutputCleaners, which are mutated
+// from the control socket (addPersistentOutput) and from a SIGHUP reload, both of
+// which run on a different goroutine than whichever protocol handler is
+// concurrently calling RecordWriter.Write. It only protects writes made
+// from this package; RecordWriter.Write itself is responsible for reading
+// the slice safely.
+var outputsMu sync.Mutex
+
+// extraOutputWriters/extraOutputCleaners hold writers that live outside the
+// --output args rebuilt on every reload: the metrics writer (setupMetrics)
+// and anything added at runtime via the control socket's "add_output".
+// reloadCapture replays these on top of the freshly rebuilt output set so
+// a SIGHUP doesn't silently drop them. Guarded by outputsMu.
+var extraOutputWriters []flamingo.OutputWriter
+var extraOutputCleaners []flamingo.OutputCleaner
+
+// configuredCleaners is the cleaner set for the current --output args, as
+// last built by setupOutput. reloadCapture diffs against this (not the
+// combined rw.OutputCleaners, which also holds the never-torn-down extra
+// cleaners) to know what to tear down after rebuilding. Guarded by
+// outputsMu.
+var configuredCleaners []flamingo.OutputCleaner
+
+// cleanupHandlers holds teardown funcs for process-wide resources that
+// aren't protocol listeners, such as the control socket.
 var cleanupHandlers = []func(){}
 
+// failSetup reports a protocol setup error (a bad port range, or a bind
+// failure with !IgnoreFailures): log.Fatalf at startup, same as always, but
+// only log.Errorf during a SIGHUP reload, since a typo'd port or a
+// transient bind failure in the reloaded config must never os.Exit an
+// already-running honeypot.
+func failSetup(reload bool, format string, args ...interface{}) {
+	if reload {
+		log.Errorf(format, args...)
+		return
+	}
+	log.Fatalf(format, args...)
+}
+
+// registerListener records a freshly spawned listener and bumps
+// protocolCount, replacing the protocolCount++/cleanupHandlers pair every
+// setup* function used to repeat inline.
+func registerListener(proto string, port int, shutdown func()) {
+	listenersMu.Lock()
+	defer listenersMu.Unlock()
+	listeners = append(listeners, activeListener{proto: proto, port: port, shutdown: shutdown})
+	protocolCount++
+	setListenerGauge(proto, port, true)
+}
+
 func startCapture(cmd *cobra.Command, args []string) {
 
 	running := false
@@ -65,40 +125,40 @@ func startCapture(cmd *cobra.Command, args []string) {
 
 	}()
 
-	// Process CLI arguments
-	protocols := make(map[string]bool)
-	for _, pname := range strings.Split(params.Protocols, ",") {
-		pname = strings.TrimSpace(pname)
-		protocols[pname] = true
-	}
-
 	// Configure output actions
 	rw := setupOutput(args)
+	configuredCleaners = rw.OutputCleaners
 
 	// Configure TLS certificates
 	setupTLS()
 
 	// Setup protocol listeners
+	setupProtocols(rw, enabledProtocols(), false)
 
-	// SNMP
-	if _, enabled := protocols["snmp"]; enabled {
-		setupSNMP(rw)
+	// Make sure at least one capture is running
+	if protocolCount == 0 {
+		log.Fatalf("at least one protocol must be enabled")
 	}
 
-	// SSH
-	if _, enabled := protocols["ssh"]; enabled {
-		setupSSH(rw)
+	// Prometheus metrics endpoint
+	if params.MetricsAddr != "" {
+		setupMetrics(rw, params.MetricsAddr)
 	}
 
-	// LDAP/LDAPS
-	if _, enabled := protocols["ldap"]; enabled {
-		setupLDAP(rw)
-		setupLDAPS(rw)
-	}
+	// SIGHUP triggers a live reload of protocols/ports/outputs; see reload.go
+	hups := make(chan os.Signal, 1)
+	signal.Notify(hups, syscall.SIGHUP)
+	go func() {
+		for range hups {
+			reloadCapture(rw, args)
+		}
+	}()
 
-	// Make sure at least one capture is running
-	if protocolCount == 0 {
-		log.Fatalf("at least one protocol must be enabled")
+	// An optional control socket lets operators manage a running flamingo
+	// without a restart or a signal; see control.go
+	if params.ControlSocket != "" {
+		ctl := startControlSocket(params.ControlSocket, rw)
+		cleanupHandlers = append(cleanupHandlers, func() { ctl.Close() })
 	}
 
 	state.Lock()
@@ -111,6 +171,14 @@ func startCapture(cmd *cobra.Command, args []string) {
 			log.Printf("shutting down...")
 
 			// Clean up protocol handlers
+			listenersMu.Lock()
+			for _, l := range listeners {
+				l.shutdown()
+				setListenerGauge(l.proto, l.port, false)
+			}
+			listenersMu.Unlock()
+
+			// Clean up everything else (e.g. the control socket)
 			for _, handler := range cleanupHandlers {
 				handler()
 			}
@@ -128,6 +196,54 @@ func startCapture(cmd *cobra.Command, args []string) {
 	}
 }
 
+// enabledProtocols parses the comma-separated --protocols flag into a set.
+func enabledProtocols() map[string]bool {
+	protocols := make(map[string]bool)
+	for _, pname := range strings.Split(params.Protocols, ",") {
+		pname = strings.TrimSpace(pname)
+		protocols[pname] = true
+	}
+	return protocols
+}
+
+// setupProtocols spawns a listener for every protocol enabled in protocols.
+// It is called once at startup with the full set (reload=false, so any
+// setup error is fatal), and again from reloadCapture with just the
+// newly-enabled ones (reload=true, so a setup error is logged and skipped
+// instead of taking down the running process).
+func setupProtocols(rw *flamingo.RecordWriter, protocols map[string]bool, reload bool) {
+	if protocols["snmp"] {
+		setupSNMP(rw, reload)
+	}
+
+	if protocols["ssh"] {
+		setupSSH(rw, reload)
+	}
+
+	if protocols["ldap"] {
+		setupLDAP(rw, reload)
+		setupLDAPS(rw, reload)
+	}
+
+	if protocols["http"] {
+		setupHTTP(rw, reload)
+	}
+	if protocols["https"] {
+		setupHTTPS(rw, reload)
+	}
+
+	if protocols["ftp"] {
+		setupFTP(rw, reload)
+	}
+	if protocols["ftps"] {
+		setupFTPS(rw, reload)
+	}
+
+	if protocols["telnet"] {
+		setupTelnet(rw, reload)
+	}
+}
+
 func setupOutput(outputs []string) *flamingo.RecordWriter {
 	stdoutLogging := false
 
@@ -145,27 +261,9 @@ func setupOutput(outputs []string) *flamingo.RecordWriter {
 			continue
 		}
 
-		if strings.HasPrefix(output, "http://") || strings.HasPrefix(output, "https://") {
-			writer, cleaner, err := getWebhookWriter(output)
-			if err != nil {
-				log.Fatalf("failed to configure output %s: %s", output, err)
-			}
-			rw.OutputWriters = append(rw.OutputWriters, writer)
-			if cleaner != nil {
-				rw.OutputCleaners = append(rw.OutputCleaners, cleaner)
-			}
-			continue
-		}
-
-		// Assume anything else is a file output
-		writer, cleaner, err := getFileWriter(output)
-		if err != nil {
+		if err := addOutput(rw, output); err != nil {
 			log.Fatalf("failed to configure output %s: %s", output, err)
 		}
-		rw.OutputWriters = append(rw.OutputWriters, writer)
-		if cleaner != nil {
-			rw.OutputCleaners = append(rw.OutputCleaners, cleaner)
-		}
 	}
 
 	// Always log to standard output
@@ -176,6 +274,67 @@ func setupOutput(outputs []string) *flamingo.RecordWriter {
 	return rw
 }
 
+// buildOutput resolves a single --output destination to its writer and
+// (optional) cleaner, without touching any RecordWriter.
+func buildOutput(output string) (flamingo.OutputWriter, flamingo.OutputCleaner, error) {
+	if output == "-" {
+		return stdoutWriter, nil, nil
+	}
+
+	if scheme := outputScheme(output); scheme != "" {
+		switch {
+		case scheme == "tcp" || scheme == "syslog":
+			return getNetWriter(output)
+		case strings.Contains(scheme, "http"):
+			return getWebhookWriter(output)
+		default:
+			return nil, nil, fmt.Errorf("unsupported output scheme: %s", scheme)
+		}
+	}
+
+	// Assume anything else is a file output
+	return getFileWriter(output)
+}
+
+// addOutput configures a single output destination and appends its writer
+// (and cleaner, if any) to rw. Used by setupOutput for the --output args
+// given at startup, which reloadCapture rebuilds wholesale on every SIGHUP;
+// for outputs that should survive a reload, use addPersistentOutput instead.
+func addOutput(rw *flamingo.RecordWriter, output string) error {
+	writer, cleaner, err := buildOutput(output)
+	if err != nil {
+		return err
+	}
+
+	outputsMu.Lock()
+	rw.OutputWriters = append(rw.OutputWriters, writer)
+	if cleaner != nil {
+		rw.OutputCleaners = append(rw.OutputCleaners, cleaner)
+	}
+	outputsMu.Unlock()
+	return nil
+}
+
+// addPersistentOutput is addOutput plus bookkeeping so the output survives
+// a SIGHUP reload, which otherwise only knows about the --output args given
+// at startup. Used by the control socket's "add_output" command.
+func addPersistentOutput(rw *flamingo.RecordWriter, output string) error {
+	writer, cleaner, err := buildOutput(output)
+	if err != nil {
+		return err
+	}
+
+	outputsMu.Lock()
+	rw.OutputWriters = append(rw.OutputWriters, writer)
+	extraOutputWriters = append(extraOutputWriters, writer)
+	if cleaner != nil {
+		rw.OutputCleaners = append(rw.OutputCleaners, cleaner)
+		extraOutputCleaners = append(extraOutputCleaners, cleaner)
+	}
+	outputsMu.Unlock()
+	return nil
+}
+
 func stdoutWriter(rec map[string]string) error {
 	lf := log.Fields{}
 	for k, v := range rec {
@@ -205,14 +364,103 @@ func getFileWriter(path string) (flamingo.OutputWriter, flamingo.OutputCleaner,
 	}, func() { fd.Close() }, nil
 }
 
-func getWebhookWriter(url string) (flamingo.OutputWriter, flamingo.OutputCleaner, error) {
-	return func(rec map[string]string) error {
-		bytes, err := json.Marshal(rec)
-		if err != nil {
-			return err
+func setupFTP(rw *flamingo.RecordWriter, reload bool) {
+
+	// Create a listener for each port
+	ftpPorts, err := flamingo.CrackPorts(params.FTPPorts)
+	if err != nil {
+		failSetup(reload, "failed to process ftp ports %s: %s", params.FTPPorts, err)
+		return
+	}
+
+	for _, port := range ftpPorts {
+		port := port
+		ftpConf := flamingo.NewConfFTP()
+		ftpConf.BindPort = uint16(port)
+		ftpConf.RecordWriter = rw
+		ftpConf.TLSCert = params.TLSCertData
+		ftpConf.TLSKey = params.TLSKeyData
+		ftpConf.TLSName = params.TLSName
+		ftpConf.TranscriptDir = params.TranscriptDir
+		if err := flamingo.SpawnFTP(ftpConf); err != nil {
+			if !params.IgnoreFailures {
+				failSetup(reload, "failed to start ftp server %s:%d: %s", ftpConf.BindHost, ftpConf.BindPort, err)
+			} else {
+				log.Errorf("failed to start ftp server %s:%d: %s", ftpConf.BindHost, ftpConf.BindPort, err)
+			}
+			continue
 		}
-		return sendWebhook(url, string(bytes))
-	}, flamingo.OutputCleanerNoOp, nil
+		registerListener("ftp", port, func() { ftpConf.Shutdown() })
+	}
+}
+
+func setupFTPS(rw *flamingo.RecordWriter, reload bool) {
+
+	// Create a listener for each port
+	ftpsPorts, err := flamingo.CrackPorts(params.FTPSPorts)
+	if err != nil {
+		failSetup(reload, "failed to process ftps ports %s: %s", params.FTPSPorts, err)
+		return
+	}
+
+	for _, port := range ftpsPorts {
+		port := port
+		ftpConf := flamingo.NewConfFTP()
+		ftpConf.BindPort = uint16(port)
+		ftpConf.RecordWriter = rw
+		ftpConf.TLS = true
+		ftpConf.TLSCert = params.TLSCertData
+		ftpConf.TLSKey = params.TLSKeyData
+		ftpConf.TLSName = params.TLSName
+		ftpConf.TranscriptDir = params.TranscriptDir
+		if err := flamingo.SpawnFTP(ftpConf); err != nil {
+			if !params.IgnoreFailures {
+				failSetup(reload, "failed to start ftps server %s:%d: %s", ftpConf.BindHost, ftpConf.BindPort, err)
+			} else {
+				log.Errorf("failed to start ftps server %s:%d: %s", ftpConf.BindHost, ftpConf.BindPort, err)
+			}
+			continue
+		}
+		registerListener("ftps", port, func() { ftpConf.Shutdown() })
+	}
+}
+
+func setupTelnet(rw *flamingo.RecordWriter, reload bool) {
+
+	// Create a listener for each port
+	telnetPorts, err := flamingo.CrackPorts(params.TelnetPorts)
+	if err != nil {
+		failSetup(reload, "failed to process telnet ports %s: %s", params.TelnetPorts, err)
+		return
+	}
+
+	for _, port := range telnetPorts {
+		port := port
+		telnetConf := flamingo.NewConfTelnet()
+		telnetConf.BindPort = uint16(port)
+		telnetConf.RecordWriter = rw
+		telnetConf.TranscriptDir = params.TranscriptDir
+		if err := flamingo.SpawnTelnet(telnetConf); err != nil {
+			if !params.IgnoreFailures {
+				failSetup(reload, "failed to start telnet server %s:%d: %s", telnetConf.BindHost, telnetConf.BindPort, err)
+			} else {
+				log.Errorf("failed to start telnet server %s:%d: %s", telnetConf.BindHost, telnetConf.BindPort, err)
+			}
+			continue
+		}
+		registerListener("telnet", port, func() { telnetConf.Shutdown() })
+	}
+}
+
+// outputScheme returns the URL scheme of an output destination (e.g. "tcp",
+// "https", or a sink-prefixed scheme like "splunk-hec+https"), or "" if the
+// output isn't a URL at all (a bare file path).
+func outputScheme(output string) string {
+	u, err := neturl.Parse(output)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return ""
+	}
+	return u.Scheme
 }
 
 func setupTLS() {
@@ -241,12 +489,13 @@ func setupTLS() {
 	}
 }
 
-func setupSSH(rw *flamingo.RecordWriter) {
+func setupSSH(rw *flamingo.RecordWriter, reload bool) {
 	sshHostKey := ""
 	if params.SSHHostKey != "" {
 		data, err := ioutil.ReadFile(params.SSHHostKey)
 		if err != nil {
-			log.Fatalf("failed to read ssh host key %s: %s", params.SSHHostKey, err)
+			failSetup(reload, "failed to read ssh host key %s: %s", params.SSHHostKey, err)
+			return
 		}
 		sshHostKey = string(data)
 	}
@@ -254,7 +503,8 @@ func setupSSH(rw *flamingo.RecordWriter) {
 	if params.SSHHostKey == "" {
 		pkey, err := flamingo.SSHGenerateRSAKey(2048)
 		if err != nil {
-			log.Fatalf("failed to create ssh host key: %s", err)
+			failSetup(reload, "failed to create ssh host key: %s", err)
+			return
 		}
 		sshHostKey = string(pkey)
 	}
@@ -262,7 +512,8 @@ func setupSSH(rw *flamingo.RecordWriter) {
 	// Create a listener for each port
 	sshPorts, err := flamingo.CrackPorts(params.SSHPorts)
 	if err != nil {
-		log.Fatalf("failed to process ssh ports %s: %s", params.SSHPorts, err)
+		failSetup(reload, "failed to process ssh ports %s: %s", params.SSHPorts, err)
+		return
 	}
 	for _, port := range sshPorts {
 		port := port
@@ -270,25 +521,26 @@ func setupSSH(rw *flamingo.RecordWriter) {
 		sshConf.PrivateKey = sshHostKey
 		sshConf.BindPort = uint16(port)
 		sshConf.RecordWriter = rw
+		sshConf.TranscriptDir = params.TranscriptDir
 		if err := flamingo.SpawnSSH(sshConf); err != nil {
 			if !params.IgnoreFailures {
-				log.Fatalf("failed to start ssh server %s:%d: %s", sshConf.BindHost, sshConf.BindPort, err)
+				failSetup(reload, "failed to start ssh server %s:%d: %s", sshConf.BindHost, sshConf.BindPort, err)
 			} else {
 				log.Errorf("failed to start ssh server %s:%d: %s", sshConf.BindHost, sshConf.BindPort, err)
 			}
 			continue
 		}
-		protocolCount++
-		cleanupHandlers = append(cleanupHandlers, func() { sshConf.Shutdown() })
+		registerListener("ssh", port, func() { sshConf.Shutdown() })
 	}
 }
 
-func setupSNMP(rw *flamingo.RecordWriter) {
+func setupSNMP(rw *flamingo.RecordWriter, reload bool) {
 
 	// Create a listener for each port
 	snmpPorts, err := flamingo.CrackPorts(params.SNMPPorts)
 	if err != nil {
-		log.Fatalf("failed to process snmp ports %s: %s", params.SSHPorts, err)
+		failSetup(reload, "failed to process snmp ports %s: %s", params.SSHPorts, err)
+		return
 	}
 
 	for _, port := range snmpPorts {
@@ -298,23 +550,23 @@ func setupSNMP(rw *flamingo.RecordWriter) {
 		snmpConf.RecordWriter = rw
 		if err := flamingo.SpawnSNMP(snmpConf); err != nil {
 			if !params.IgnoreFailures {
-				log.Fatalf("failed to start snmp server %s:%d: %s", snmpConf.BindHost, snmpConf.BindPort, err)
+				failSetup(reload, "failed to start snmp server %s:%d: %s", snmpConf.BindHost, snmpConf.BindPort, err)
 			} else {
 				log.Errorf("failed to start snmb server %s:%d: %s", snmpConf.BindHost, snmpConf.BindPort, err)
 			}
 			continue
 		}
-		protocolCount++
-		cleanupHandlers = append(cleanupHandlers, func() { snmpConf.Shutdown() })
+		registerListener("snmp", port, func() { snmpConf.Shutdown() })
 	}
 }
 
-func setupLDAP(rw *flamingo.RecordWriter) {
+func setupLDAP(rw *flamingo.RecordWriter, reload bool) {
 
 	// Create a listener for each port
 	ldapPorts, err := flamingo.CrackPorts(params.LDAPPorts)
 	if err != nil {
-		log.Fatalf("failed to process ldap ports %s: %s", params.LDAPPorts, err)
+		failSetup(reload, "failed to process ldap ports %s: %s", params.LDAPPorts, err)
+		return
 	}
 
 	for _, port := range ldapPorts {
@@ -322,25 +574,26 @@ func setupLDAP(rw *flamingo.RecordWriter) {
 		ldapConf := flamingo.NewConfLDAP()
 		ldapConf.BindPort = uint16(port)
 		ldapConf.RecordWriter = rw
+		ldapConf.TranscriptDir = params.TranscriptDir
 		if err := flamingo.SpawnLDAP(ldapConf); err != nil {
 			if !params.IgnoreFailures {
-				log.Fatalf("failed to start ldap server %s:%d: %s", ldapConf.BindHost, ldapConf.BindPort, err)
+				failSetup(reload, "failed to start ldap server %s:%d: %s", ldapConf.BindHost, ldapConf.BindPort, err)
 			} else {
 				log.Errorf("failed to start ldap server %s:%d: %s", ldapConf.BindHost, ldapConf.BindPort, err)
 			}
 			continue
 		}
-		protocolCount++
-		cleanupHandlers = append(cleanupHandlers, func() { ldapConf.Shutdown() })
+		registerListener("ldap", port, func() { ldapConf.Shutdown() })
 	}
 }
 
-func setupLDAPS(rw *flamingo.RecordWriter) {
+func setupLDAPS(rw *flamingo.RecordWriter, reload bool) {
 
 	// Create a listener for each port
 	ldapsPorts, err := flamingo.CrackPorts(params.LDAPSPorts)
 	if err != nil {
-		log.Fatalf("failed to process ldap ports %s: %s", params.LDAPSPorts, err)
+		failSetup(reload, "failed to process ldap ports %s: %s", params.LDAPSPorts, err)
+		return
 	}
 
 	for _, port := range ldapsPorts {
@@ -352,38 +605,73 @@ func setupLDAPS(rw *flamingo.RecordWriter) {
 		ldapConf.TLSCert = params.TLSCertData
 		ldapConf.TLSKey = params.TLSKeyData
 		ldapConf.TLSName = params.TLSName
+		ldapConf.TranscriptDir = params.TranscriptDir
 		if err := flamingo.SpawnLDAP(ldapConf); err != nil {
 			if !params.IgnoreFailures {
-				log.Fatalf("failed to start ldaps server %s:%d: %q", ldapConf.BindHost, ldapConf.BindPort, err)
+				failSetup(reload, "failed to start ldaps server %s:%d: %q", ldapConf.BindHost, ldapConf.BindPort, err)
 			} else {
 				log.Errorf("failed to start ldaps server %s:%d: %q", ldapConf.BindHost, ldapConf.BindPort, err)
 			}
 			continue
 		}
-		protocolCount++
-		cleanupHandlers = append(cleanupHandlers, func() { ldapConf.Shutdown() })
+		registerListener("ldaps", port, func() { ldapConf.Shutdown() })
 	}
 }
 
-func sendWebhook(url string, msg string) error {
-	body, _ := json.Marshal(map[string]string{"text": msg})
-	req, err := http.NewRequest(http.MethodPost, url, bytes.NewBuffer(body))
+func setupHTTP(rw *flamingo.RecordWriter, reload bool) {
+
+	// Create a listener for each port
+	httpPorts, err := flamingo.CrackPorts(params.HTTPPorts)
 	if err != nil {
-		return err
+		failSetup(reload, "failed to process http ports %s: %s", params.HTTPPorts, err)
+		return
+	}
+
+	for _, port := range httpPorts {
+		port := port
+		httpConf := flamingo.NewConfHTTP()
+		httpConf.BindPort = uint16(port)
+		httpConf.RecordWriter = rw
+		httpConf.TranscriptDir = params.TranscriptDir
+		if err := flamingo.SpawnHTTP(httpConf); err != nil {
+			if !params.IgnoreFailures {
+				failSetup(reload, "failed to start http server %s:%d: %s", httpConf.BindHost, httpConf.BindPort, err)
+			} else {
+				log.Errorf("failed to start http server %s:%d: %s", httpConf.BindHost, httpConf.BindPort, err)
+			}
+			continue
+		}
+		registerListener("http", port, func() { httpConf.Shutdown() })
 	}
+}
 
-	req.Header.Set("User-Agent", fmt.Sprintf("flamingo/%s", Version))
-	req.Header.Set("Content-Type", "application/json")
+func setupHTTPS(rw *flamingo.RecordWriter, reload bool) {
 
-	client := &http.Client{Timeout: time.Second * time.Duration(15)}
-	resp, err := client.Do(req)
+	// Create a listener for each port
+	httpsPorts, err := flamingo.CrackPorts(params.HTTPSPorts)
 	if err != nil {
-		return err
+		failSetup(reload, "failed to process https ports %s: %s", params.HTTPSPorts, err)
+		return
 	}
 
-	if resp.StatusCode < 200 || resp.StatusCode > 299 {
-		return fmt.Errorf("bad response: %d", resp.StatusCode)
+	for _, port := range httpsPorts {
+		port := port
+		httpConf := flamingo.NewConfHTTP()
+		httpConf.BindPort = uint16(port)
+		httpConf.RecordWriter = rw
+		httpConf.TLS = true
+		httpConf.TLSCert = params.TLSCertData
+		httpConf.TLSKey = params.TLSKeyData
+		httpConf.TLSName = params.TLSName
+		httpConf.TranscriptDir = params.TranscriptDir
+		if err := flamingo.SpawnHTTP(httpConf); err != nil {
+			if !params.IgnoreFailures {
+				failSetup(reload, "failed to start https server %s:%d: %s", httpConf.BindHost, httpConf.BindPort, err)
+			} else {
+				log.Errorf("failed to start https server %s:%d: %s", httpConf.BindHost, httpConf.BindPort, err)
+			}
+			continue
+		}
+		registerListener("https", port, func() { httpConf.Shutdown() })
 	}
-
-	return nil
-}
\ No newline at end of file
+}
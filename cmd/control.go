@@ -0,0 +1,111 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+
+	"github.com/atredispartners/flamingo/pkg/flamingo"
+	log "github.com/sirupsen/logrus"
+)
+
+// controlRequest is a single JSON command sent to the control socket, e.g.
+//
+//	{"op":"add_output","url":"splunk-hec+https://token@host/"}
+//	{"op":"list_listeners"}
+//	{"op":"stop","proto":"ssh","port":2222}
+type controlRequest struct {
+	Op    string `json:"op"`
+	URL   string `json:"url,omitempty"`
+	Proto string `json:"proto,omitempty"`
+	Port  int    `json:"port,omitempty"`
+}
+
+type controlResponse struct {
+	OK        bool                     `json:"ok"`
+	Error     string                   `json:"error,omitempty"`
+	Listeners []map[string]interface{} `json:"listeners,omitempty"`
+}
+
+// startControlSocket listens on a Unix-domain socket at path for JSON
+// control commands, so operators can manage a running flamingo instance
+// (add an output, list or stop listeners) without a restart.
+func startControlSocket(path string, rw *flamingo.RecordWriter) net.Listener {
+	os.Remove(path)
+
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		log.Fatalf("failed to create control socket %s: %s", path, err)
+	}
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go handleControlConn(conn, rw)
+		}
+	}()
+
+	return ln
+}
+
+func handleControlConn(conn net.Conn, rw *flamingo.RecordWriter) {
+	defer conn.Close()
+
+	var req controlRequest
+	if err := json.NewDecoder(conn).Decode(&req); err != nil {
+		json.NewEncoder(conn).Encode(controlResponse{Error: err.Error()})
+		return
+	}
+
+	enc := json.NewEncoder(conn)
+
+	switch req.Op {
+	case "add_output":
+		if err := addPersistentOutput(rw, req.URL); err != nil {
+			enc.Encode(controlResponse{Error: err.Error()})
+			return
+		}
+		enc.Encode(controlResponse{OK: true})
+
+	case "list_listeners":
+		listenersMu.Lock()
+		info := make([]map[string]interface{}, 0, len(listeners))
+		for _, l := range listeners {
+			info = append(info, map[string]interface{}{"proto": l.proto, "port": l.port})
+		}
+		listenersMu.Unlock()
+		enc.Encode(controlResponse{OK: true, Listeners: info})
+
+	case "stop":
+		if stopListener(req.Proto, req.Port) {
+			enc.Encode(controlResponse{OK: true})
+		} else {
+			enc.Encode(controlResponse{Error: fmt.Sprintf("no %s listener on port %d", req.Proto, req.Port)})
+		}
+
+	default:
+		enc.Encode(controlResponse{Error: "unknown op: " + req.Op})
+	}
+}
+
+// stopListener tears down a single running listener identified by protocol
+// and port. Used by the "stop" control command.
+func stopListener(proto string, port int) bool {
+	listenersMu.Lock()
+	defer listenersMu.Unlock()
+
+	for i, l := range listeners {
+		if l.proto == proto && l.port == port {
+			l.shutdown()
+			listeners = append(listeners[:i], listeners[i+1:]...)
+			protocolCount--
+			setListenerGauge(proto, port, false)
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,212 @@
+package cmd
+
+import (
+	"encoding/json"
+	"io/ioutil"
+
+	"github.com/atredispartners/flamingo/pkg/flamingo"
+	log "github.com/sirupsen/logrus"
+)
+
+// reloadableConfig is the subset of params that reloadParams will overwrite
+// from params.ConfigFile on SIGHUP. Everything else (bind host, TLS names,
+// the control socket path, ...) is fixed for the life of the process, same
+// as if --config were never given.
+type reloadableConfig struct {
+	Protocols   string `json:"protocols"`
+	SSHPorts    string `json:"ssh_ports"`
+	SNMPPorts   string `json:"snmp_ports"`
+	LDAPPorts   string `json:"ldap_ports"`
+	LDAPSPorts  string `json:"ldaps_ports"`
+	HTTPPorts   string `json:"http_ports"`
+	HTTPSPorts  string `json:"https_ports"`
+	FTPPorts    string `json:"ftp_ports"`
+	FTPSPorts   string `json:"ftps_ports"`
+	TelnetPorts string `json:"telnet_ports"`
+}
+
+// reloadParams re-reads params.ConfigFile, if one was given with --config,
+// and applies any protocol/port changes found there. Without --config,
+// reloadCapture's diff against the (unchanged) params is always a no-op by
+// design: there is nothing else for SIGHUP to re-read.
+func reloadParams() error {
+	if params.ConfigFile == "" {
+		return nil
+	}
+
+	data, err := ioutil.ReadFile(params.ConfigFile)
+	if err != nil {
+		return err
+	}
+
+	var cfg reloadableConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return err
+	}
+
+	if cfg.Protocols != "" {
+		params.Protocols = cfg.Protocols
+	}
+	if cfg.SSHPorts != "" {
+		params.SSHPorts = cfg.SSHPorts
+	}
+	if cfg.SNMPPorts != "" {
+		params.SNMPPorts = cfg.SNMPPorts
+	}
+	if cfg.LDAPPorts != "" {
+		params.LDAPPorts = cfg.LDAPPorts
+	}
+	if cfg.LDAPSPorts != "" {
+		params.LDAPSPorts = cfg.LDAPSPorts
+	}
+	if cfg.HTTPPorts != "" {
+		params.HTTPPorts = cfg.HTTPPorts
+	}
+	if cfg.HTTPSPorts != "" {
+		params.HTTPSPorts = cfg.HTTPSPorts
+	}
+	if cfg.FTPPorts != "" {
+		params.FTPPorts = cfg.FTPPorts
+	}
+	if cfg.FTPSPorts != "" {
+		params.FTPSPorts = cfg.FTPSPorts
+	}
+	if cfg.TelnetPorts != "" {
+		params.TelnetPorts = cfg.TelnetPorts
+	}
+
+	return nil
+}
+
+// reloadCapture re-reads the running configuration in response to SIGHUP:
+// it starts listeners for newly-enabled (protocol, port) pairs, shuts down
+// ones that were removed or whose port changed, and rebuilds the output
+// writer set. The old writers stay live until the new set has fully taken
+// over, so no in-flight record is dropped mid-reload.
+func reloadCapture(rw *flamingo.RecordWriter, outputs []string) {
+	log.Printf("reloading configuration...")
+
+	if err := reloadParams(); err != nil {
+		log.Errorf("failed to reload %s: %s", params.ConfigFile, err)
+	}
+
+	desired := enabledProtocols()
+	desiredPortSet := desiredPorts(desired)
+
+	listenersMu.Lock()
+	running := make(map[string]map[int]bool)
+	var toStop []activeListener
+	var keep []activeListener
+	for _, l := range listeners {
+		if desiredPortSet[l.proto][l.port] {
+			keep = append(keep, l)
+			if running[l.proto] == nil {
+				running[l.proto] = make(map[int]bool)
+			}
+			running[l.proto][l.port] = true
+		} else {
+			toStop = append(toStop, l)
+		}
+	}
+	listeners = keep
+	listenersMu.Unlock()
+
+	for _, l := range toStop {
+		log.Printf("stopping %s listener on port %d", l.proto, l.port)
+		l.shutdown()
+		listenersMu.Lock()
+		protocolCount--
+		listenersMu.Unlock()
+		setListenerGauge(l.proto, l.port, false)
+	}
+
+	// A protocol needs its setup* function re-run if any of its desired
+	// ports aren't already running. setup* re-cracks the full port range
+	// for the protocol from params, so a port that's already bound (kept
+	// above) will fail to re-bind here with a harmless "address in use"
+	// log, rather than silently missing a changed port-range.
+	newlyEnabled := make(map[string]bool)
+	for proto, ports := range desiredPortSet {
+		for port := range ports {
+			if !running[proto][port] {
+				if proto == "ldaps" {
+					// setupProtocols starts ldaps listeners under "ldap"
+					newlyEnabled["ldap"] = true
+				} else {
+					newlyEnabled[proto] = true
+				}
+			}
+		}
+	}
+	if len(newlyEnabled) > 0 {
+		setupTLS()
+		setupProtocols(rw, newlyEnabled, true)
+	}
+
+	// Rebuild output writers from the --output args. This has to happen
+	// before outputsMu is taken: setupOutput calls addOutput per
+	// destination, and addOutput takes outputsMu itself, so holding the
+	// lock across the call would deadlock against its own reentrant
+	// attempt to acquire it. Only the slice swap itself needs the lock.
+	oldConfigured := configuredCleaners
+	newRW := setupOutput(outputs)
+
+	outputsMu.Lock()
+	configuredCleaners = newRW.OutputCleaners
+	rw.OutputWriters = append(newRW.OutputWriters, extraOutputWriters...)
+	rw.OutputCleaners = append(newRW.OutputCleaners, extraOutputCleaners...)
+	outputsMu.Unlock()
+
+	for _, cleaner := range oldConfigured {
+		cleaner()
+	}
+
+	log.Printf("reload complete: %d listener(s) active", protocolCount)
+}
+
+// desiredPorts computes the (protocol -> port set) the running config
+// should have bound, for every protocol enabled in desired, by cracking
+// each protocol's port-range flag the same way its setup* function does.
+// "ldaps" rides on the "ldap" flag, same as at startup, since there's no
+// separate ldaps toggle.
+func desiredPorts(desired map[string]bool) map[string]map[int]bool {
+	portSpecs := map[string]string{
+		"snmp":   params.SNMPPorts,
+		"ssh":    params.SSHPorts,
+		"ldap":   params.LDAPPorts,
+		"ldaps":  params.LDAPSPorts,
+		"http":   params.HTTPPorts,
+		"https":  params.HTTPSPorts,
+		"ftp":    params.FTPPorts,
+		"ftps":   params.FTPSPorts,
+		"telnet": params.TelnetPorts,
+	}
+
+	result := make(map[string]map[int]bool)
+	for proto, spec := range portSpecs {
+		if !protocolDesired(desired, proto) {
+			continue
+		}
+		ports, err := flamingo.CrackPorts(spec)
+		if err != nil {
+			log.Errorf("failed to process %s ports %s: %s", proto, spec, err)
+			continue
+		}
+		set := make(map[int]bool, len(ports))
+		for _, port := range ports {
+			set[port] = true
+		}
+		result[proto] = set
+	}
+	return result
+}
+
+// protocolDesired reports whether the listener proto should still be
+// running given the desired protocol set. "ldaps" rides on the "ldap" flag,
+// same as at startup, since there's no separate ldaps toggle.
+func protocolDesired(desired map[string]bool, proto string) bool {
+	if proto == "ldaps" {
+		return desired["ldap"]
+	}
+	return desired[proto]
+}
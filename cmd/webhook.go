@@ -0,0 +1,315 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log/syslog"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/atredispartners/flamingo/pkg/flamingo"
+	log "github.com/sirupsen/logrus"
+)
+
+// sinkFormatter builds the request body and content type for a single
+// record, for a given destination URL (credentials, if any, are still
+// attached to dest's userinfo).
+type sinkFormatter func(rec map[string]string, dest *url.URL) (body []byte, contentType string, err error)
+
+// sinkAuth derives an Authorization header from a destination URL's
+// userinfo, when the sink expects credentials that way.
+type sinkAuth func(dest *url.URL) (header string, value string)
+
+// sinkEndpoint rewrites the destination URL a sink's body actually gets
+// delivered to, when that differs from the configured output URL (e.g. the
+// elastic sink's NDJSON body has to go to the _bulk endpoint, not the bare
+// index URL). Sinks that don't set one deliver straight to the parsed dest.
+type sinkEndpoint func(dest *url.URL) *url.URL
+
+type webhookSink struct {
+	format   sinkFormatter
+	auth     sinkAuth
+	endpoint sinkEndpoint
+}
+
+// webhookSinks maps the scheme prefix of a "<sink>+http(s)://" output URL to
+// the formatter/auth pair that builds its payload. A bare http(s):// URL
+// with no prefix falls back to the original Slack-compatible {"text": ...}
+// envelope.
+var webhookSinks = map[string]webhookSink{
+	"slack":      {format: formatSlack},
+	"discord":    {format: formatDiscord},
+	"teams":      {format: formatTeams},
+	"splunk-hec": {format: formatSplunkHEC, auth: authSplunkHEC},
+	"elastic":    {format: formatElastic, auth: authBasicFromURL, endpoint: elasticBulkEndpoint},
+}
+
+// getWebhookWriter builds an OutputWriter that POSTs each record to an
+// HTTP(S) webhook, retrying with backoff on failure.
+func getWebhookWriter(rawURL string) (flamingo.OutputWriter, flamingo.OutputCleaner, error) {
+	sinkName, dest, err := parseSinkURL(rawURL)
+	if err != nil {
+		return flamingo.OutputWriterNoOp, nil, err
+	}
+
+	sink, ok := webhookSinks[sinkName]
+	if !ok {
+		sink = webhookSink{format: formatSlack}
+	}
+
+	timeout := 15 * time.Second
+	if t := dest.Query().Get("timeout"); t != "" {
+		if d, err := time.ParseDuration(t); err == nil {
+			timeout = d
+		}
+	}
+	client := &http.Client{Timeout: timeout}
+
+	deliverDest := dest
+	if sink.endpoint != nil {
+		deliverDest = sink.endpoint(dest)
+	}
+
+	return func(rec map[string]string) error {
+		body, contentType, err := sink.format(rec, dest)
+		if err != nil {
+			return err
+		}
+		authHeader, authValue := "", ""
+		if sink.auth != nil {
+			authHeader, authValue = sink.auth(dest)
+		}
+		return postWithRetry(client, deliverDest, contentType, body, authHeader, authValue)
+	}, flamingo.OutputCleanerNoOp, nil
+}
+
+// parseSinkURL splits a "<sink>+http(s)://..." output into the sink name and
+// the underlying http(s) URL to deliver to. Plain http(s):// URLs have no
+// sink name and are treated as "slack" for backward compatibility.
+func parseSinkURL(rawURL string) (string, *url.URL, error) {
+	sinkName := ""
+	rest := rawURL
+	if idx := strings.Index(rawURL, "+http"); idx >= 0 {
+		sinkName = rawURL[:idx]
+		rest = rawURL[idx+1:]
+	}
+
+	dest, err := url.Parse(rest)
+	if err != nil {
+		return "", nil, err
+	}
+	return sinkName, dest, nil
+}
+
+func postWithRetry(client *http.Client, dest *url.URL, contentType string, body []byte, authHeader, authValue string) error {
+	const maxAttempts = 3
+	backoff := 500 * time.Millisecond
+
+	var lastErr error
+	for attempt := 0; attempt < maxAttempts; attempt++ {
+		req, err := http.NewRequest(http.MethodPost, dest.String(), bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("User-Agent", fmt.Sprintf("flamingo/%s", Version))
+		req.Header.Set("Content-Type", contentType)
+		if authHeader != "" {
+			req.Header.Set(authHeader, authValue)
+		}
+
+		resp, err := client.Do(req)
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode >= 200 && resp.StatusCode <= 299 {
+				return nil
+			}
+			lastErr = fmt.Errorf("bad response: %d", resp.StatusCode)
+		} else {
+			lastErr = err
+		}
+
+		if attempt == maxAttempts-1 {
+			break
+		}
+		log.Warnf("webhook delivery to %s failed (attempt %d/%d): %s", dest.Host, attempt+1, maxAttempts, lastErr)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+
+	return lastErr
+}
+
+func formatSlack(rec map[string]string, dest *url.URL) ([]byte, string, error) {
+	msg, err := json.Marshal(rec)
+	if err != nil {
+		return nil, "", err
+	}
+	body, err := json.Marshal(map[string]string{"text": string(msg)})
+	return body, "application/json", err
+}
+
+func formatDiscord(rec map[string]string, dest *url.URL) ([]byte, string, error) {
+	msg, err := json.Marshal(rec)
+	if err != nil {
+		return nil, "", err
+	}
+	body, err := json.Marshal(map[string]string{"content": string(msg)})
+	return body, "application/json", err
+}
+
+func formatTeams(rec map[string]string, dest *url.URL) ([]byte, string, error) {
+	msg, err := json.Marshal(rec)
+	if err != nil {
+		return nil, "", err
+	}
+	card := map[string]interface{}{
+		"@type":    "MessageCard",
+		"@context": "http://schema.org/extensions",
+		"title":    "flamingo credential capture",
+		"text":     string(msg),
+	}
+	body, err := json.Marshal(card)
+	return body, "application/json", err
+}
+
+func formatSplunkHEC(rec map[string]string, dest *url.URL) ([]byte, string, error) {
+	event := map[string]interface{}{
+		"event":      rec,
+		"sourcetype": "flamingo",
+	}
+	body, err := json.Marshal(event)
+	return body, "application/json", err
+}
+
+func authSplunkHEC(dest *url.URL) (string, string) {
+	if dest.User == nil {
+		return "", ""
+	}
+	token := dest.User.Username()
+	if token == "" {
+		return "", ""
+	}
+	return "Authorization", "Splunk " + token
+}
+
+func formatElastic(rec map[string]string, dest *url.URL) ([]byte, string, error) {
+	index := strings.Trim(dest.Path, "/")
+	action, err := json.Marshal(map[string]interface{}{"index": map[string]string{"_index": index}})
+	if err != nil {
+		return nil, "", err
+	}
+	doc, err := json.Marshal(rec)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var buf bytes.Buffer
+	buf.Write(action)
+	buf.WriteByte('\n')
+	buf.Write(doc)
+	buf.WriteByte('\n')
+	return buf.Bytes(), "application/x-ndjson", nil
+}
+
+// elasticBulkEndpoint returns the URL formatElastic's NDJSON body actually
+// has to be POSTed to: Elasticsearch rejects a _bulk body sent to a bare
+// index URL, and the action line in that body already carries _index, so
+// the index from dest.Path isn't needed in the path too. Userinfo is
+// stripped since authBasicFromURL already turns it into an Authorization
+// header; leaving it in the delivered URL would just echo the credentials
+// back out in cleartext.
+func elasticBulkEndpoint(dest *url.URL) *url.URL {
+	bulk := *dest
+	bulk.User = nil
+	bulk.Path = "/_bulk"
+	return &bulk
+}
+
+func authBasicFromURL(dest *url.URL) (string, string) {
+	if dest.User == nil {
+		return "", ""
+	}
+	user := dest.User.Username()
+	pass, _ := dest.User.Password()
+	if user == "" {
+		return "", ""
+	}
+	return "Authorization", "Basic " + base64.StdEncoding.EncodeToString([]byte(user+":"+pass))
+}
+
+// getNetWriter builds an OutputWriter for line-oriented network sinks:
+// tcp://host:port writes each record as a JSON line, syslog://host:port
+// forwards each record as a syslog message, for feeding a SIEM directly.
+func getNetWriter(rawURL string) (flamingo.OutputWriter, flamingo.OutputCleaner, error) {
+	dest, err := url.Parse(rawURL)
+	if err != nil {
+		return flamingo.OutputWriterNoOp, nil, err
+	}
+
+	switch dest.Scheme {
+	case "tcp":
+		return getTCPWriter(dest.Host)
+	case "syslog":
+		return getSyslogWriter(dest.Host)
+	}
+
+	return flamingo.OutputWriterNoOp, nil, fmt.Errorf("unsupported net sink scheme: %s", dest.Scheme)
+}
+
+func getTCPWriter(addr string) (flamingo.OutputWriter, flamingo.OutputCleaner, error) {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return flamingo.OutputWriterNoOp, nil, err
+	}
+
+	// RecordWriter may call this writer from multiple protocol goroutines
+	// concurrently, so the connection (and any reconnect on write failure)
+	// has to be serialized rather than racing on the shared conn variable.
+	var mu sync.Mutex
+
+	return func(rec map[string]string) error {
+			line, err := json.Marshal(rec)
+			if err != nil {
+				return err
+			}
+			line = append(line, '\n')
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			if _, werr := conn.Write(line); werr != nil {
+				conn, err = net.Dial("tcp", addr)
+				if err != nil {
+					return fmt.Errorf("tcp sink %s unreachable: %s", addr, err)
+				}
+				_, err = conn.Write(line)
+				return err
+			}
+			return nil
+		}, func() {
+			mu.Lock()
+			defer mu.Unlock()
+			conn.Close()
+		}, nil
+}
+
+func getSyslogWriter(addr string) (flamingo.OutputWriter, flamingo.OutputCleaner, error) {
+	writer, err := syslog.Dial("tcp", addr, syslog.LOG_INFO|syslog.LOG_AUTH, "flamingo")
+	if err != nil {
+		return flamingo.OutputWriterNoOp, nil, err
+	}
+
+	return func(rec map[string]string) error {
+		line, err := json.Marshal(rec)
+		if err != nil {
+			return err
+		}
+		return writer.Info(string(line))
+	}, func() { writer.Close() }, nil
+}
@@ -0,0 +1,181 @@
+package flamingo
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ConfFTP holds the configuration for a single FTP/FTPS capture listener.
+// Setting TLS wraps the listener for implicit FTPS (typically port 990);
+// explicit FTPS (AUTH TLS on the plaintext port 21) is always honored
+// regardless of TLS, as long as TLSCert/TLSKey are set.
+type ConfFTP struct {
+	BindHost      string
+	BindPort      uint16
+	TLS           bool
+	TLSCert       string
+	TLSKey        string
+	TLSName       string
+	Banner        string
+	RecordWriter  *RecordWriter
+	TranscriptDir string
+
+	listener net.Listener
+}
+
+// NewConfFTP returns a ConfFTP with sane defaults.
+func NewConfFTP() *ConfFTP {
+	return &ConfFTP{
+		BindHost: "0.0.0.0",
+		Banner:   "220 FTP server ready",
+	}
+}
+
+// SpawnFTP starts an FTP listener that accepts enough of RFC 959 to capture
+// USER/PASS credentials before rejecting the login.
+func SpawnFTP(conf *ConfFTP) error {
+	addr := fmt.Sprintf("%s:%d", conf.BindHost, conf.BindPort)
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	if conf.TLS {
+		cert, err := tls.X509KeyPair([]byte(conf.TLSCert), []byte(conf.TLSKey))
+		if err != nil {
+			ln.Close()
+			return err
+		}
+		ln = WrapTLSHandshakeMetrics(tls.NewListener(ln, &tls.Config{Certificates: []tls.Certificate{cert}, ServerName: conf.TLSName}), "ftps")
+	}
+
+	conf.listener = ln
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go handleFTPConn(conf, conn)
+		}
+	}()
+
+	return nil
+}
+
+// Shutdown stops the listener started by SpawnFTP.
+func (c *ConfFTP) Shutdown() {
+	if c.listener != nil {
+		c.listener.Close()
+	}
+}
+
+func handleFTPConn(conf *ConfFTP, rawConn net.Conn) {
+	sessionID := NewSessionID()
+	transcript := NewTranscript(conf.TranscriptDir, sessionID)
+	conn := WrapTranscript(rawConn, transcript)
+	defer func() { conn.Close() }()
+
+	connectedAt := time.Now()
+
+	protocol := "ftp"
+	if conf.TLS {
+		protocol = "ftps"
+	}
+
+	rec := map[string]string{
+		"protocol":   protocol,
+		"src_host":   rawConn.RemoteAddr().String(),
+		"session_id": sessionID,
+	}
+
+	if conf.RecordWriter != nil {
+		conf.RecordWriter.Write(withEvent(rec, "connect"))
+	}
+	defer func() {
+		if conf.RecordWriter != nil {
+			conf.RecordWriter.Write(withEvent(rec, "disconnect"))
+		}
+		MetricSessionDuration.WithLabelValues(rec["protocol"]).Observe(time.Since(connectedAt).Seconds())
+	}()
+
+	rw := bufio.NewReader(conn)
+	fmt.Fprintf(conn, "%s\r\n", conf.Banner)
+
+	for {
+		line, err := rw.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+
+		cmd, arg := splitFTPCommand(line)
+		switch strings.ToUpper(cmd) {
+		case "USER":
+			rec["username"] = arg
+			fmt.Fprintf(conn, "331 Password required for %s\r\n", arg)
+
+		case "PASS":
+			rec["password"] = arg
+			if conf.RecordWriter != nil {
+				conf.RecordWriter.Write(withEvent(rec, "auth_attempt"))
+			}
+			fmt.Fprintf(conn, "530 Login incorrect\r\n")
+
+		case "AUTH":
+			if strings.EqualFold(arg, "TLS") && conf.TLSCert != "" && conf.TLSKey != "" {
+				fmt.Fprintf(conn, "234 AUTH TLS successful\r\n")
+				// Handshake on the raw connection, not the already
+				// transcript-wrapped one, so the transcript only ever
+				// sees one layer of traffic for a given direction.
+				tlsConn, err := upgradeFTPTLS(rawConn, conf)
+				if err != nil {
+					log.Errorf("ftp explicit tls upgrade failed: %s", err)
+					return
+				}
+				conn = WrapTranscript(tlsConn, transcript)
+				rw = bufio.NewReader(conn)
+				rec["tls"] = "explicit"
+				rec["protocol"] = "ftps"
+				continue
+			}
+			fmt.Fprintf(conn, "502 Command not implemented\r\n")
+
+		case "QUIT":
+			fmt.Fprintf(conn, "221 Goodbye\r\n")
+			return
+
+		default:
+			fmt.Fprintf(conn, "502 Command not implemented\r\n")
+		}
+	}
+}
+
+func upgradeFTPTLS(conn net.Conn, conf *ConfFTP) (net.Conn, error) {
+	cert, err := tls.X509KeyPair([]byte(conf.TLSCert), []byte(conf.TLSKey))
+	if err != nil {
+		return nil, err
+	}
+	tlsConn := tls.Server(conn, &tls.Config{Certificates: []tls.Certificate{cert}, ServerName: conf.TLSName})
+	if err := tlsConn.Handshake(); err != nil {
+		MetricTLSHandshakeFailures.WithLabelValues("ftps-explicit").Inc()
+		return nil, err
+	}
+	return tlsConn, nil
+}
+
+func splitFTPCommand(line string) (string, string) {
+	parts := strings.SplitN(line, " ", 2)
+	if len(parts) == 1 {
+		return parts[0], ""
+	}
+	return parts[0], parts[1]
+}
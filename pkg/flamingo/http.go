@@ -0,0 +1,256 @@
+package flamingo
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ConfHTTP holds the configuration for a single HTTP or HTTPS capture
+// listener. It mirrors ConfLDAP so that the TLS bootstrap in setupTLS can be
+// reused unchanged for the HTTPS case.
+type ConfHTTP struct {
+	BindHost      string
+	BindPort      uint16
+	TLS           bool
+	TLSCert       string
+	TLSKey        string
+	TLSName       string
+	Realm         string
+	RecordWriter  *RecordWriter
+	TranscriptDir string
+
+	listener net.Listener
+	server   *http.Server
+}
+
+// httpSessionConn tags an accepted connection with the session ID its
+// traffic is (or would be) transcripted under, so the handler can attach the
+// same session_id to every request made over it.
+type httpSessionConn struct {
+	net.Conn
+	sessionID string
+}
+
+// httpSessionListener assigns a session ID to every accepted connection and
+// wraps it for transcript capture, the same way the raw-socket protocols do.
+type httpSessionListener struct {
+	net.Listener
+	transcriptDir string
+}
+
+func (l *httpSessionListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	sessionID := NewSessionID()
+	wrapped := WrapTranscript(conn, NewTranscript(l.transcriptDir, sessionID))
+	return &httpSessionConn{Conn: wrapped, sessionID: sessionID}, nil
+}
+
+type httpContextKey string
+
+const httpSessionIDKey httpContextKey = "session_id"
+
+// NewConfHTTP returns a ConfHTTP with sane defaults.
+func NewConfHTTP() *ConfHTTP {
+	return &ConfHTTP{
+		BindHost: "0.0.0.0",
+		Realm:    "flamingo",
+	}
+}
+
+// SpawnHTTP starts an HTTP(S) listener that challenges every request for
+// Basic and NTLM credentials and logs whatever the client sends back.
+func SpawnHTTP(conf *ConfHTTP) error {
+	addr := fmt.Sprintf("%s:%d", conf.BindHost, conf.BindPort)
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	if conf.TLS {
+		cert, err := tls.X509KeyPair([]byte(conf.TLSCert), []byte(conf.TLSKey))
+		if err != nil {
+			ln.Close()
+			return err
+		}
+		ln = WrapTLSHandshakeMetrics(tls.NewListener(ln, &tls.Config{Certificates: []tls.Certificate{cert}, ServerName: conf.TLSName}), "https")
+	}
+
+	// Wrap last so the transcript only ever sees the decrypted stream, not
+	// the raw TLS bytes.
+	ln = &httpSessionListener{Listener: ln, transcriptDir: conf.TranscriptDir}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", httpCaptureHandler(conf))
+
+	conf.listener = ln
+	conf.server = &http.Server{
+		Addr:    addr,
+		Handler: mux,
+		ConnContext: func(ctx context.Context, c net.Conn) context.Context {
+			if sc, ok := c.(*httpSessionConn); ok {
+				return context.WithValue(ctx, httpSessionIDKey, sc.sessionID)
+			}
+			return ctx
+		},
+	}
+
+	go func() {
+		if err := conf.server.Serve(ln); err != nil && err != http.ErrServerClosed {
+			log.Errorf("http server %s error: %s", addr, err)
+		}
+	}()
+
+	return nil
+}
+
+// Shutdown stops the listener started by SpawnHTTP.
+func (c *ConfHTTP) Shutdown() {
+	if c.listener != nil {
+		c.listener.Close()
+	}
+}
+
+func (c *ConfHTTP) proto() string {
+	if c.TLS {
+		return "https"
+	}
+	return "http"
+}
+
+func httpCaptureHandler(conf *ConfHTTP) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		requestStart := time.Now()
+		defer func() {
+			MetricSessionDuration.WithLabelValues(conf.proto()).Observe(time.Since(requestStart).Seconds())
+		}()
+
+		sessionID, _ := r.Context().Value(httpSessionIDKey).(string)
+		if sessionID == "" {
+			sessionID = NewSessionID()
+		}
+
+		rec := map[string]string{
+			"protocol":   conf.proto(),
+			"src_host":   r.RemoteAddr,
+			"host":       r.Host,
+			"path":       r.URL.Path,
+			"user_agent": r.UserAgent(),
+			"session_id": sessionID,
+		}
+
+		switch auth := r.Header.Get("Authorization"); {
+		case strings.HasPrefix(auth, "Basic "):
+			if decoded, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(auth, "Basic ")); err == nil {
+				parts := strings.SplitN(string(decoded), ":", 2)
+				rec["username"] = parts[0]
+				if len(parts) > 1 {
+					rec["password"] = parts[1]
+				}
+				conf.emit(withEvent(rec, "auth_attempt"))
+			}
+
+		case strings.HasPrefix(auth, "NTLM "):
+			blob, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(auth, "NTLM "))
+			if err != nil {
+				break
+			}
+
+			switch ntlmMessageType(blob) {
+			case 1:
+				// Negotiate: hand back a fixed challenge so the client
+				// replies with a Type 3 message we can decode.
+				w.Header().Set("WWW-Authenticate", "NTLM "+base64.StdEncoding.EncodeToString(ntlmChallenge()))
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			case 3:
+				rec["ntlm_response"] = base64.StdEncoding.EncodeToString(blob)
+				if domain, user, workstation, ok := parseNTLMAuthenticate(blob); ok {
+					rec["username"] = user
+					rec["domain"] = domain
+					rec["workstation"] = workstation
+				}
+				conf.emit(withEvent(rec, "auth_attempt"))
+			}
+		}
+
+		w.Header().Set("WWW-Authenticate", `Basic realm="`+conf.Realm+`"`)
+		w.Header().Add("WWW-Authenticate", "NTLM")
+		w.WriteHeader(http.StatusUnauthorized)
+	}
+}
+
+func (c *ConfHTTP) emit(rec map[string]string) {
+	if c.RecordWriter != nil {
+		c.RecordWriter.Write(rec)
+	}
+}
+
+// ntlmChallenge returns a minimal, static Type 2 NTLM message carrying an
+// 8-byte server challenge. It is not meant to be cryptographically
+// meaningful, only to elicit a Type 3 response from the client.
+func ntlmChallenge() []byte {
+	msg := make([]byte, 32)
+	copy(msg, []byte("NTLMSSP\x00"))
+	binary.LittleEndian.PutUint32(msg[8:], 2)
+	copy(msg[24:], []byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08})
+	return msg
+}
+
+func ntlmMessageType(blob []byte) uint32 {
+	if len(blob) < 12 || string(blob[:7]) != "NTLMSSP" {
+		return 0
+	}
+	return binary.LittleEndian.Uint32(blob[8:12])
+}
+
+// parseNTLMAuthenticate extracts the domain, username and workstation
+// security buffers from a Type 3 NTLM message.
+func parseNTLMAuthenticate(blob []byte) (domain, user, workstation string, ok bool) {
+	readBuffer := func(fieldOffset int) string {
+		if fieldOffset+8 > len(blob) {
+			return ""
+		}
+		length := binary.LittleEndian.Uint16(blob[fieldOffset:])
+		offset := binary.LittleEndian.Uint32(blob[fieldOffset+4:])
+		if int(offset)+int(length) > len(blob) || int(offset) < 0 {
+			return ""
+		}
+		return decodeNTLMString(blob[offset : offset+uint32(length)])
+	}
+
+	if len(blob) < 44 {
+		return "", "", "", false
+	}
+
+	domain = readBuffer(28)
+	user = readBuffer(36)
+	workstation = readBuffer(44)
+	return domain, user, workstation, true
+}
+
+// decodeNTLMString decodes the UTF-16LE strings NTLM uses for its security
+// buffers, one code unit per rune (surrogate pairs are not combined),
+// falling back to the raw bytes if the field has an odd byte length.
+func decodeNTLMString(b []byte) string {
+	if len(b)%2 != 0 {
+		return string(b)
+	}
+	runes := make([]rune, 0, len(b)/2)
+	for i := 0; i < len(b); i += 2 {
+		runes = append(runes, rune(binary.LittleEndian.Uint16(b[i:])))
+	}
+	return string(runes)
+}
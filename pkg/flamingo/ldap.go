@@ -0,0 +1,433 @@
+package flamingo
+
+import (
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// ConfLDAP holds the configuration for a single LDAP/LDAPS capture
+// listener.
+type ConfLDAP struct {
+	BindHost      string
+	BindPort      uint16
+	TLS           bool
+	TLSCert       string
+	TLSKey        string
+	TLSName       string
+	RecordWriter  *RecordWriter
+	TranscriptDir string
+
+	listener net.Listener
+}
+
+// NewConfLDAP returns a ConfLDAP with sane defaults.
+func NewConfLDAP() *ConfLDAP {
+	return &ConfLDAP{
+		BindHost: "0.0.0.0",
+	}
+}
+
+// SpawnLDAP starts an LDAP listener that decodes enough of RFC 4511 to
+// capture BindRequest credentials (simple or SASL) and SearchRequest
+// filters before responding with a failure, same spirit as SpawnFTP.
+func SpawnLDAP(conf *ConfLDAP) error {
+	addr := fmt.Sprintf("%s:%d", conf.BindHost, conf.BindPort)
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	protocol := "ldap"
+	if conf.TLS {
+		protocol = "ldaps"
+		cert, err := tls.X509KeyPair([]byte(conf.TLSCert), []byte(conf.TLSKey))
+		if err != nil {
+			ln.Close()
+			return err
+		}
+		ln = WrapTLSHandshakeMetrics(tls.NewListener(ln, &tls.Config{Certificates: []tls.Certificate{cert}, ServerName: conf.TLSName}), "ldaps")
+	}
+
+	conf.listener = ln
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go handleLDAPConn(conf, conn, protocol)
+		}
+	}()
+
+	return nil
+}
+
+// Shutdown stops the listener started by SpawnLDAP.
+func (c *ConfLDAP) Shutdown() {
+	if c.listener != nil {
+		c.listener.Close()
+	}
+}
+
+func handleLDAPConn(conf *ConfLDAP, rawConn net.Conn, protocol string) {
+	sessionID := NewSessionID()
+	conn := WrapTranscript(rawConn, NewTranscript(conf.TranscriptDir, sessionID))
+	defer conn.Close()
+
+	connectedAt := time.Now()
+
+	rec := map[string]string{
+		"protocol":   protocol,
+		"src_host":   rawConn.RemoteAddr().String(),
+		"session_id": sessionID,
+	}
+
+	if conf.RecordWriter != nil {
+		conf.RecordWriter.Write(withEvent(rec, "connect"))
+	}
+	defer func() {
+		if conf.RecordWriter != nil {
+			conf.RecordWriter.Write(withEvent(rec, "disconnect"))
+		}
+		MetricSessionDuration.WithLabelValues(protocol).Observe(time.Since(connectedAt).Seconds())
+	}()
+
+	for {
+		msg, err := readBERElement(conn)
+		if err != nil {
+			return
+		}
+
+		messageID, op, opTag, err := parseLDAPMessage(msg)
+		if err != nil {
+			return
+		}
+
+		switch opTag {
+		case ldapOpBindRequest:
+			name, authType, password, mechanism := parseBindRequest(op)
+			bindRec := withEvent(rec, "auth_attempt")
+			bindRec["username"] = name
+			bindRec["auth_method"] = authType
+			if authType == "sasl" {
+				bindRec["sasl_mechanism"] = mechanism
+			} else {
+				bindRec["password"] = password
+			}
+			if conf.RecordWriter != nil {
+				conf.RecordWriter.Write(bindRec)
+			}
+			if _, err := conn.Write(encodeLDAPMessage(messageID, encodeBindResponse(ldapResultInvalidCredentials))); err != nil {
+				return
+			}
+
+		case ldapOpSearchRequest:
+			baseObject, filter := parseSearchRequest(op)
+			searchRec := withEvent(rec, "command")
+			searchRec["command"] = fmt.Sprintf("search base=%q filter=%q", baseObject, filter)
+			if conf.RecordWriter != nil {
+				conf.RecordWriter.Write(searchRec)
+			}
+			if _, err := conn.Write(encodeLDAPMessage(messageID, encodeSearchResultDone(ldapResultNoSuchObject))); err != nil {
+				return
+			}
+
+		case ldapOpUnbindRequest:
+			return
+
+		default:
+			// Anything else (modify, add, delete, compare, extended, ...)
+			// isn't decoded; close rather than pretend to understand it.
+			return
+		}
+	}
+}
+
+// LDAP APPLICATION-class protocolOp tags (RFC 4511 section 4.2/4.5.1).
+const (
+	ldapOpBindRequest            byte = 0x60
+	ldapOpBindResponse           byte = 0x61
+	ldapOpUnbindRequest          byte = 0x42
+	ldapOpSearchRequest          byte = 0x63
+	ldapOpSearchDone             byte = 0x65
+	ldapResultInvalidCredentials      = 49
+	ldapResultNoSuchObject            = 32
+)
+
+// LDAP AuthenticationChoice context-specific tags (RFC 4511 section 4.2).
+const (
+	ldapAuthSimple byte = 0x80
+	ldapAuthSASL   byte = 0xA3
+)
+
+// LDAP Filter CHOICE context-specific tags (RFC 4511 section 4.5.1.7).
+const (
+	ldapFilterAnd            byte = 0xA0
+	ldapFilterOr             byte = 0xA1
+	ldapFilterNot            byte = 0xA2
+	ldapFilterEqualityMatch  byte = 0xA3
+	ldapFilterGreaterOrEqual byte = 0xA5
+	ldapFilterLessOrEqual    byte = 0xA6
+	ldapFilterPresent        byte = 0x87
+	ldapFilterApproxMatch    byte = 0xA8
+)
+
+// berTLV is a single decoded BER tag-length-value element, with value being
+// its raw content octets (still BER-encoded if the tag is constructed).
+type berTLV struct {
+	tag   byte
+	value []byte
+}
+
+// readBERElement reads one full BER TLV off r (a definite-length, short- or
+// long-form encoding, which is all LDAPMessage ever uses on the wire) and
+// returns its raw bytes including the tag and length octets.
+func readBERElement(r io.Reader) ([]byte, error) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+
+	length := int(header[1])
+	lengthOctets := []byte{}
+	if header[1]&0x80 != 0 {
+		n := int(header[1] & 0x7F)
+		if n == 0 || n > 4 {
+			return nil, fmt.Errorf("unsupported BER length form")
+		}
+		lengthOctets = make([]byte, n)
+		if _, err := io.ReadFull(r, lengthOctets); err != nil {
+			return nil, err
+		}
+		length = 0
+		for _, b := range lengthOctets {
+			length = length<<8 | int(b)
+		}
+	}
+
+	value := make([]byte, length)
+	if _, err := io.ReadFull(r, value); err != nil {
+		return nil, err
+	}
+
+	element := make([]byte, 0, 2+len(lengthOctets)+length)
+	element = append(element, header...)
+	element = append(element, lengthOctets...)
+	element = append(element, value...)
+	return element, nil
+}
+
+// decodeBERTLVs decodes a concatenation of sibling BER TLVs (the content of
+// a constructed element) into its top-level elements, without recursing
+// into their values.
+func decodeBERTLVs(data []byte) []berTLV {
+	var elements []berTLV
+	for len(data) >= 2 {
+		tag := data[0]
+		length := int(data[1])
+		rest := data[2:]
+		if data[1]&0x80 != 0 {
+			n := int(data[1] & 0x7F)
+			if n == 0 || n > 4 || len(rest) < n {
+				return elements
+			}
+			length = 0
+			for _, b := range rest[:n] {
+				length = length<<8 | int(b)
+			}
+			rest = rest[n:]
+		}
+		if length > len(rest) {
+			return elements
+		}
+		elements = append(elements, berTLV{tag: tag, value: rest[:length]})
+		data = rest[length:]
+	}
+	return elements
+}
+
+// parseLDAPMessage decodes the outer LDAPMessage SEQUENCE { messageID
+// INTEGER, protocolOp CHOICE { ... } } and returns the message ID, the raw
+// protocolOp content, and its APPLICATION tag.
+func parseLDAPMessage(msg []byte) (int, []byte, byte, error) {
+	top := decodeBERTLVs(msg)
+	if len(top) == 0 {
+		return 0, nil, 0, fmt.Errorf("empty LDAPMessage")
+	}
+	fields := decodeBERTLVs(top[0].value)
+	if len(fields) < 2 {
+		return 0, nil, 0, fmt.Errorf("malformed LDAPMessage")
+	}
+	messageID := berInt(fields[0].value)
+	return messageID, fields[1].value, fields[1].tag, nil
+}
+
+// berInt decodes a big-endian two's-complement BER INTEGER value.
+func berInt(value []byte) int {
+	n := 0
+	if len(value) > 0 && value[0]&0x80 != 0 {
+		n = -1
+	}
+	for _, b := range value {
+		n = n<<8 | int(b)
+	}
+	return n
+}
+
+// parseBindRequest decodes a BindRequest's content: version, name, and the
+// AuthenticationChoice (simple password, or SASL mechanism+credentials).
+func parseBindRequest(op []byte) (name, authType, password, mechanism string) {
+	fields := decodeBERTLVs(op)
+	if len(fields) < 3 {
+		return "", "", "", ""
+	}
+	name = string(fields[1].value)
+
+	auth := fields[2]
+	switch auth.tag {
+	case ldapAuthSimple:
+		return name, "simple", string(auth.value), ""
+	case ldapAuthSASL:
+		saslFields := decodeBERTLVs(auth.value)
+		if len(saslFields) > 0 {
+			mechanism = string(saslFields[0].value)
+		}
+		return name, "sasl", "", mechanism
+	default:
+		return name, "unknown", "", ""
+	}
+}
+
+// parseSearchRequest decodes a SearchRequest's baseObject and renders its
+// filter as a human-readable string; the scope/derefAliases/sizeLimit/
+// timeLimit/typesOnly fields and the attributes list aren't captured.
+func parseSearchRequest(op []byte) (string, string) {
+	fields := decodeBERTLVs(op)
+	if len(fields) < 7 {
+		return "", ""
+	}
+	baseObject := string(fields[0].value)
+	filter := formatLDAPFilter(fields[6])
+	return baseObject, filter
+}
+
+// formatLDAPFilter recursively renders a Filter CHOICE element as an
+// RFC 4515-style string.
+func formatLDAPFilter(f berTLV) string {
+	switch f.tag {
+	case ldapFilterAnd:
+		return "(&" + formatLDAPFilterSet(f.value) + ")"
+	case ldapFilterOr:
+		return "(|" + formatLDAPFilterSet(f.value) + ")"
+	case ldapFilterNot:
+		inner := decodeBERTLVs(f.value)
+		if len(inner) == 0 {
+			return "(!)"
+		}
+		return "(!" + formatLDAPFilter(inner[0]) + ")"
+	case ldapFilterEqualityMatch:
+		return formatAVA(f.value, "=")
+	case ldapFilterGreaterOrEqual:
+		return formatAVA(f.value, ">=")
+	case ldapFilterLessOrEqual:
+		return formatAVA(f.value, "<=")
+	case ldapFilterApproxMatch:
+		return formatAVA(f.value, "~=")
+	case ldapFilterPresent:
+		return fmt.Sprintf("(%s=*)", string(f.value))
+	default:
+		return fmt.Sprintf("(unsupported-filter-0x%02x)", f.tag)
+	}
+}
+
+// formatLDAPFilterSet renders a set of sibling Filter elements (the content
+// of an "and"/"or" filter), concatenated with no separator as RFC 4515
+// requires.
+func formatLDAPFilterSet(data []byte) string {
+	var sb strings.Builder
+	for _, f := range decodeBERTLVs(data) {
+		sb.WriteString(formatLDAPFilter(f))
+	}
+	return sb.String()
+}
+
+// formatAVA renders an AttributeValueAssertion SEQUENCE { attributeDesc,
+// assertionValue } as "(attr<op>value)".
+func formatAVA(data []byte, op string) string {
+	fields := decodeBERTLVs(data)
+	if len(fields) < 2 {
+		return "(unsupported-ava)"
+	}
+	return fmt.Sprintf("(%s%s%s)", string(fields[0].value), op, string(fields[1].value))
+}
+
+// encodeBERLength encodes n as a BER length octet sequence (short form
+// below 128, long form otherwise).
+func encodeBERLength(n int) []byte {
+	if n < 0x80 {
+		return []byte{byte(n)}
+	}
+	var octets []byte
+	for n > 0 {
+		octets = append([]byte{byte(n & 0xFF)}, octets...)
+		n >>= 8
+	}
+	return append([]byte{0x80 | byte(len(octets))}, octets...)
+}
+
+// encodeBERElement encodes a TLV with the given tag and already-encoded
+// value.
+func encodeBERElement(tag byte, value []byte) []byte {
+	element := []byte{tag}
+	element = append(element, encodeBERLength(len(value))...)
+	element = append(element, value...)
+	return element
+}
+
+// encodeBERInt encodes n as a BER INTEGER value (content octets only, no
+// tag/length).
+func encodeBERInt(n int) []byte {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, uint64(n))
+	i := 0
+	for i < len(buf)-1 && buf[i] == 0 && buf[i+1]&0x80 == 0 {
+		i++
+	}
+	return buf[i:]
+}
+
+// encodeLDAPResult encodes an LDAPResult SEQUENCE { resultCode, matchedDN,
+// diagnosticMessage } under the given APPLICATION tag, with empty
+// matchedDN/diagnosticMessage.
+func encodeLDAPResult(appTag byte, resultCode int) []byte {
+	content := encodeBERElement(0x0A, encodeBERInt(resultCode)) // ENUMERATED
+	content = append(content, encodeBERElement(0x04, nil)...)   // matchedDN
+	content = append(content, encodeBERElement(0x04, nil)...)   // diagnosticMessage
+	return encodeBERElement(appTag, content)
+}
+
+// encodeBindResponse builds a BindResponse with the given resultCode.
+func encodeBindResponse(resultCode int) []byte {
+	return encodeLDAPResult(ldapOpBindResponse, resultCode)
+}
+
+// encodeSearchResultDone builds a SearchResultDone with the given
+// resultCode.
+func encodeSearchResultDone(resultCode int) []byte {
+	return encodeLDAPResult(ldapOpSearchDone, resultCode)
+}
+
+// encodeLDAPMessage wraps a pre-encoded protocolOp in the outer LDAPMessage
+// SEQUENCE { messageID INTEGER, protocolOp }.
+func encodeLDAPMessage(messageID int, op []byte) []byte {
+	content := encodeBERElement(0x02, encodeBERInt(messageID)) // INTEGER
+	content = append(content, op...)
+	return encodeBERElement(0x30, content) // SEQUENCE
+}
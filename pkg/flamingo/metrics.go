@@ -0,0 +1,103 @@
+package flamingo
+
+import (
+	"crypto/tls"
+	"net"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// MetricTLSHandshakeFailures and MetricSessionDuration are the metrics that
+// only a protocol package can observe directly (a failed handshake, or how
+// long a session ran). Everything else cmd can derive purely from captured
+// records, and is registered there instead.
+var (
+	MetricTLSHandshakeFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "flamingo_tls_handshake_failures_total",
+		Help: "TLS handshake failures, by protocol.",
+	}, []string{"protocol"})
+
+	MetricSessionDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "flamingo_session_duration_seconds",
+		Help:    "Duration of a captured session from connect to disconnect; for http/https, of a single request.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"protocol"})
+)
+
+func init() {
+	prometheus.MustRegister(MetricTLSHandshakeFailures, MetricSessionDuration)
+}
+
+// maxUniqueTracked bounds how many distinct values trackUnique remembers
+// per protocol, so a long-running honeypot under sustained scanning doesn't
+// grow uniqueSrcIPs/uniqueCreds without bound. Once a protocol hits the cap,
+// further distinct values stop being recorded and the reported count
+// saturates there; it's an approximation, not an exact distinct count, past
+// that point.
+const maxUniqueTracked = 100000
+
+var uniqueMu sync.Mutex
+var uniqueSrcIPs = map[string]map[string]struct{}{}
+var uniqueCreds = map[string]map[string]struct{}{}
+
+func trackUnique(set map[string]map[string]struct{}, protocol, value string) int {
+	uniqueMu.Lock()
+	defer uniqueMu.Unlock()
+	if set[protocol] == nil {
+		set[protocol] = map[string]struct{}{}
+	}
+	if _, seen := set[protocol][value]; !seen && len(set[protocol]) >= maxUniqueTracked {
+		return len(set[protocol])
+	}
+	set[protocol][value] = struct{}{}
+	return len(set[protocol])
+}
+
+// TrackUniqueSourceIP records srcHost as seen for protocol and returns the
+// running distinct count.
+func TrackUniqueSourceIP(protocol, srcHost string) int {
+	return trackUnique(uniqueSrcIPs, protocol, srcHost)
+}
+
+// TrackUniqueCredential records a username/password pair as seen for
+// protocol and returns the running distinct count.
+func TrackUniqueCredential(protocol, username, password string) int {
+	return trackUnique(uniqueCreds, protocol, username+"\x00"+password)
+}
+
+// tlsHandshakeListener wraps a TLS listener so that a failed handshake is
+// counted in MetricTLSHandshakeFailures instead of silently dropped.
+type tlsHandshakeListener struct {
+	net.Listener
+	protocol string
+}
+
+// WrapTLSHandshakeMetrics wraps ln so every accepted *tls.Conn is forced
+// through its handshake before being handed back, counting failures under
+// protocol.
+func WrapTLSHandshakeMetrics(ln net.Listener, protocol string) net.Listener {
+	return &tlsHandshakeListener{Listener: ln, protocol: protocol}
+}
+
+func (l *tlsHandshakeListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+
+		tlsConn, ok := conn.(*tls.Conn)
+		if !ok {
+			return conn, nil
+		}
+
+		if err := tlsConn.Handshake(); err != nil {
+			MetricTLSHandshakeFailures.WithLabelValues(l.protocol).Inc()
+			conn.Close()
+			continue
+		}
+
+		return conn, nil
+	}
+}
@@ -0,0 +1,69 @@
+package flamingo
+
+import (
+	"crypto/rand"
+	"strings"
+	"time"
+)
+
+// crockford32 is the Crockford Base32 alphabet ULID uses (it excludes I, L,
+// O and U to avoid visual ambiguity).
+const crockford32 = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// NewSessionID returns a ULID: a 48-bit millisecond timestamp followed by
+// 80 bits of randomness, lexicographically sortable by creation time.
+// The records and transcript files of one protocol session carry the same
+// session ID so they can be correlated after the fact; SSH auth_attempt
+// records (sshRecordAuthAttempt) carry no session ID.
+func NewSessionID() string {
+	var id [16]byte
+
+	ms := uint64(time.Now().UnixMilli())
+	id[0] = byte(ms >> 40)
+	id[1] = byte(ms >> 32)
+	id[2] = byte(ms >> 24)
+	id[3] = byte(ms >> 16)
+	id[4] = byte(ms >> 8)
+	id[5] = byte(ms)
+
+	rand.Read(id[6:])
+
+	return encodeULID(id)
+}
+
+func encodeULID(id [16]byte) string {
+	var sb strings.Builder
+	sb.Grow(26)
+
+	// 26 characters hold 130 bits, so the 128-bit value is left-padded with
+	// two zero bits, as ULID's canonical encoding does.
+	var bits uint64
+	bitCount := uint(2)
+
+	for _, b := range id {
+		bits = bits<<8 | uint64(b)
+		bitCount += 8
+		for bitCount >= 5 {
+			bitCount -= 5
+			sb.WriteByte(crockford32[(bits>>bitCount)&0x1F])
+		}
+	}
+	if bitCount > 0 {
+		sb.WriteByte(crockford32[(bits<<(5-bitCount))&0x1F])
+	}
+
+	return sb.String()
+}
+
+// withEvent returns a shallow copy of rec with event_type set, so that
+// successive events from the same session (connect/auth_attempt/command/
+// disconnect) don't stomp on each other's event_type when written through
+// the same RecordWriter.
+func withEvent(rec map[string]string, eventType string) map[string]string {
+	out := make(map[string]string, len(rec)+1)
+	for k, v := range rec {
+		out[k] = v
+	}
+	out["event_type"] = eventType
+	return out
+}
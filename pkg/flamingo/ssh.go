@@ -0,0 +1,249 @@
+package flamingo
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/pem"
+	"fmt"
+	"net"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// ConfSSH holds the configuration for a single SSH capture listener.
+type ConfSSH struct {
+	BindHost      string
+	BindPort      uint16
+	PrivateKey    string
+	RecordWriter  *RecordWriter
+	TranscriptDir string
+
+	listener net.Listener
+}
+
+// NewConfSSH returns a ConfSSH with sane defaults.
+func NewConfSSH() *ConfSSH {
+	return &ConfSSH{
+		BindHost: "0.0.0.0",
+	}
+}
+
+// SSHGenerateRSAKey returns a freshly generated PEM-encoded RSA private key,
+// for use as a ConfSSH host key when no --ssh-host-key was given.
+func SSHGenerateRSAKey(bits int) ([]byte, error) {
+	key, err := rsa.GenerateKey(rand.Reader, bits)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(key),
+	}), nil
+}
+
+// SpawnSSH starts an SSH listener that accepts any password or public key
+// offered, so the client opens a session channel, and captures the PTY
+// requests, exec commands and subsystems it asks for before the session
+// ends.
+func SpawnSSH(conf *ConfSSH) error {
+	signer, err := ssh.ParsePrivateKey([]byte(conf.PrivateKey))
+	if err != nil {
+		return err
+	}
+
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(meta ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			return sshRecordAuthAttempt(conf, meta, "password", string(password), "")
+		},
+		PublicKeyCallback: func(meta ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			return sshRecordAuthAttempt(conf, meta, "publickey", "", ssh.FingerprintSHA256(key))
+		},
+	}
+	config.AddHostKey(signer)
+
+	addr := fmt.Sprintf("%s:%d", conf.BindHost, conf.BindPort)
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	conf.listener = ln
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go handleSSHConn(conf, conn, config)
+		}
+	}()
+
+	return nil
+}
+
+// Shutdown stops the listener started by SpawnSSH.
+func (c *ConfSSH) Shutdown() {
+	if c.listener != nil {
+		c.listener.Close()
+	}
+}
+
+// sshRecordAuthAttempt records one password or public-key auth attempt and
+// always lets the client in, since the point is to see what it does with a
+// session, not to gate on real credentials. The record carries no
+// session_id.
+func sshRecordAuthAttempt(conf *ConfSSH, meta ssh.ConnMetadata, method, password, keyFingerprint string) (*ssh.Permissions, error) {
+	rec := map[string]string{
+		"protocol":    "ssh",
+		"src_host":    meta.RemoteAddr().String(),
+		"username":    meta.User(),
+		"auth_method": method,
+	}
+	if password != "" {
+		rec["password"] = password
+	}
+	if keyFingerprint != "" {
+		rec["public_key_fingerprint"] = keyFingerprint
+	}
+	if conf.RecordWriter != nil {
+		conf.RecordWriter.Write(withEvent(rec, "auth_attempt"))
+	}
+	return nil, nil
+}
+
+func handleSSHConn(conf *ConfSSH, rawConn net.Conn, config *ssh.ServerConfig) {
+	sessionID := NewSessionID()
+	conn := WrapTranscript(rawConn, NewTranscript(conf.TranscriptDir, sessionID))
+	defer conn.Close()
+
+	connectedAt := time.Now()
+
+	rec := map[string]string{
+		"protocol":   "ssh",
+		"src_host":   rawConn.RemoteAddr().String(),
+		"session_id": sessionID,
+	}
+
+	if conf.RecordWriter != nil {
+		conf.RecordWriter.Write(withEvent(rec, "connect"))
+	}
+	defer func() {
+		if conf.RecordWriter != nil {
+			conf.RecordWriter.Write(withEvent(rec, "disconnect"))
+		}
+		MetricSessionDuration.WithLabelValues("ssh").Observe(time.Since(connectedAt).Seconds())
+	}()
+
+	sconn, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return
+	}
+	rec["client_version"] = string(sconn.ClientVersion())
+
+	go ssh.DiscardRequests(reqs)
+
+	for newChannel := range chans {
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "unsupported channel type")
+			continue
+		}
+
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			continue
+		}
+
+		go handleSSHSession(conf, rec, channel, requests)
+	}
+}
+
+// handleSSHSession captures the requests made on a single accepted session
+// channel: the PTY geometry asked for, as a "pty" event, and an exec command
+// or subsystem, as a "command" event, each carrying the session's session_id
+// so it can be correlated with the connect/disconnect pair. A shell request
+// is answered with "Permission denied" and not recorded.
+func handleSSHSession(conf *ConfSSH, rec map[string]string, channel ssh.Channel, requests <-chan *ssh.Request) {
+	defer channel.Close()
+
+	for req := range requests {
+		switch req.Type {
+		case "pty-req":
+			if term, cols, rows, ok := parseSSHPTYRequest(req.Payload); ok {
+				ptyRec := withEvent(rec, "pty")
+				ptyRec["term"] = term
+				ptyRec["pty_size"] = fmt.Sprintf("%dx%d", cols, rows)
+				if conf.RecordWriter != nil {
+					conf.RecordWriter.Write(ptyRec)
+				}
+			}
+			req.Reply(true, nil)
+
+		case "exec":
+			cmdRec := withEvent(rec, "command")
+			cmdRec["command"] = parseSSHString(req.Payload)
+			if conf.RecordWriter != nil {
+				conf.RecordWriter.Write(cmdRec)
+			}
+			req.Reply(true, nil)
+			fmt.Fprintf(channel, "%s: command not found\r\n", cmdRec["command"])
+			return
+
+		case "subsystem":
+			subRec := withEvent(rec, "command")
+			subRec["subsystem"] = parseSSHString(req.Payload)
+			if conf.RecordWriter != nil {
+				conf.RecordWriter.Write(subRec)
+			}
+			req.Reply(false, nil)
+			return
+
+		case "shell":
+			req.Reply(true, nil)
+			fmt.Fprint(channel, "\r\nPermission denied\r\n")
+			return
+
+		default:
+			if req.WantReply {
+				req.Reply(false, nil)
+			}
+		}
+	}
+}
+
+// parseSSHString decodes a single SSH wire-format string (a uint32 length
+// followed by that many bytes), as used by the exec and subsystem request
+// payloads.
+func parseSSHString(payload []byte) string {
+	if len(payload) < 4 {
+		return ""
+	}
+	n := binary.BigEndian.Uint32(payload)
+	if int(n) > len(payload)-4 {
+		return ""
+	}
+	return string(payload[4 : 4+n])
+}
+
+// parseSSHPTYRequest decodes a pty-req payload (RFC 4254 section 6.2): a
+// wire string for TERM, then the terminal's width and height in characters.
+func parseSSHPTYRequest(payload []byte) (term string, cols, rows uint32, ok bool) {
+	if len(payload) < 4 {
+		return "", 0, 0, false
+	}
+	n := binary.BigEndian.Uint32(payload)
+	if int(n) > len(payload)-4 {
+		return "", 0, 0, false
+	}
+	term = string(payload[4 : 4+n])
+
+	rest := payload[4+n:]
+	if len(rest) < 8 {
+		return term, 0, 0, false
+	}
+	cols = binary.BigEndian.Uint32(rest[0:4])
+	rows = binary.BigEndian.Uint32(rest[4:8])
+	return term, cols, rows, true
+}
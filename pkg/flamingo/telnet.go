@@ -0,0 +1,178 @@
+package flamingo
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// Minimal Telnet IAC (RFC 854) constants, just enough to negotiate away the
+// options a real client would otherwise insist on before sending input.
+const (
+	telnetIAC  = 255
+	telnetWILL = 251
+	telnetWONT = 252
+	telnetDO   = 253
+	telnetDONT = 254
+
+	telnetOptEcho = 1
+	telnetOptSGA  = 3 // suppress go-ahead
+)
+
+// ConfTelnet holds the configuration for a single Telnet (or TelnetS)
+// capture listener.
+type ConfTelnet struct {
+	BindHost      string
+	BindPort      uint16
+	TLS           bool
+	TLSCert       string
+	TLSKey        string
+	TLSName       string
+	Banner        string
+	RecordWriter  *RecordWriter
+	TranscriptDir string
+
+	listener net.Listener
+}
+
+// NewConfTelnet returns a ConfTelnet with sane defaults.
+func NewConfTelnet() *ConfTelnet {
+	return &ConfTelnet{
+		BindHost: "0.0.0.0",
+		Banner:   "Telnet server",
+	}
+}
+
+// SpawnTelnet starts a Telnet listener that negotiates IAC options minimally
+// and prompts for login/password, logging each attempt.
+func SpawnTelnet(conf *ConfTelnet) error {
+	addr := fmt.Sprintf("%s:%d", conf.BindHost, conf.BindPort)
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	if conf.TLS {
+		cert, err := tls.X509KeyPair([]byte(conf.TLSCert), []byte(conf.TLSKey))
+		if err != nil {
+			ln.Close()
+			return err
+		}
+		ln = WrapTLSHandshakeMetrics(tls.NewListener(ln, &tls.Config{Certificates: []tls.Certificate{cert}, ServerName: conf.TLSName}), "telnets")
+	}
+
+	conf.listener = ln
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go handleTelnetConn(conf, conn)
+		}
+	}()
+
+	return nil
+}
+
+// Shutdown stops the listener started by SpawnTelnet.
+func (c *ConfTelnet) Shutdown() {
+	if c.listener != nil {
+		c.listener.Close()
+	}
+}
+
+func handleTelnetConn(conf *ConfTelnet, conn net.Conn) {
+	sessionID := NewSessionID()
+	conn = WrapTranscript(conn, NewTranscript(conf.TranscriptDir, sessionID))
+	defer conn.Close()
+
+	connectedAt := time.Now()
+
+	protocol := "telnet"
+	if conf.TLS {
+		protocol = "telnets"
+	}
+
+	rec := map[string]string{
+		"protocol":   protocol,
+		"src_host":   conn.RemoteAddr().String(),
+		"session_id": sessionID,
+	}
+
+	if conf.RecordWriter != nil {
+		conf.RecordWriter.Write(withEvent(rec, "connect"))
+	}
+	defer func() {
+		if conf.RecordWriter != nil {
+			conf.RecordWriter.Write(withEvent(rec, "disconnect"))
+		}
+		MetricSessionDuration.WithLabelValues(protocol).Observe(time.Since(connectedAt).Seconds())
+	}()
+
+	// Ask the client to let us echo and to suppress go-ahead, which is
+	// enough to get a line-oriented login prompt out of most clients.
+	conn.Write([]byte{telnetIAC, telnetWILL, telnetOptEcho})
+	conn.Write([]byte{telnetIAC, telnetWILL, telnetOptSGA})
+
+	r := bufio.NewReader(conn)
+
+	fmt.Fprint(conn, conf.Banner+"\r\n\r\nlogin: ")
+	user, ok := readTelnetLine(r)
+	if !ok {
+		return
+	}
+	rec["username"] = user
+
+	fmt.Fprint(conn, "password: ")
+	pass, ok := readTelnetLine(r)
+	if !ok {
+		return
+	}
+	rec["password"] = pass
+
+	if conf.RecordWriter != nil {
+		conf.RecordWriter.Write(withEvent(rec, "auth_attempt"))
+	}
+
+	fmt.Fprint(conn, "\r\nLogin incorrect\r\n")
+}
+
+// readTelnetLine reads a CRLF-terminated line, discarding any IAC option
+// negotiation bytes the client sends back.
+func readTelnetLine(r *bufio.Reader) (string, bool) {
+	var sb strings.Builder
+
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return "", false
+		}
+
+		if b == telnetIAC {
+			// Consume the command byte that follows (plus the option byte
+			// for WILL/WONT/DO/DONT) and drop it on the floor. Subnegotiation
+			// (SB ... SE) payload bytes are not skipped.
+			cmd, err := r.ReadByte()
+			if err != nil {
+				return "", false
+			}
+			if cmd == telnetWILL || cmd == telnetWONT || cmd == telnetDO || cmd == telnetDONT {
+				if _, err := r.ReadByte(); err != nil {
+					return "", false
+				}
+			}
+			continue
+		}
+
+		if b == '\n' {
+			return strings.TrimRight(sb.String(), "\r"), true
+		}
+		sb.WriteByte(b)
+	}
+}
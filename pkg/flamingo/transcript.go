@@ -0,0 +1,76 @@
+package flamingo
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+)
+
+// Transcript appends the raw bytes exchanged on a single session to
+// per-direction files under dir, named after the session ID, for later
+// replay. A Transcript with an empty dir is a no-op.
+type Transcript struct {
+	dir       string
+	sessionID string
+}
+
+// NewTranscript returns a Transcript that writes under dir, or a no-op
+// Transcript if dir is empty (the --transcript-dir flag wasn't set).
+func NewTranscript(dir, sessionID string) *Transcript {
+	return &Transcript{dir: dir, sessionID: sessionID}
+}
+
+func (t *Transcript) logClientToServer(b []byte) {
+	t.append("client-to-server", b)
+}
+
+func (t *Transcript) logServerToClient(b []byte) {
+	t.append("server-to-client", b)
+}
+
+func (t *Transcript) append(direction string, b []byte) {
+	if t == nil || t.dir == "" || len(b) == 0 {
+		return
+	}
+
+	path := filepath.Join(t.dir, fmt.Sprintf("%s.%s.raw", t.sessionID, direction))
+	fd, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return
+	}
+	defer fd.Close()
+	fd.Write(b)
+}
+
+// transcriptConn wraps a net.Conn so every Read/Write is mirrored to the
+// session's Transcript.
+type transcriptConn struct {
+	net.Conn
+	transcript *Transcript
+}
+
+func (c *transcriptConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if n > 0 {
+		c.transcript.logClientToServer(b[:n])
+	}
+	return n, err
+}
+
+func (c *transcriptConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	if n > 0 {
+		c.transcript.logServerToClient(b[:n])
+	}
+	return n, err
+}
+
+// WrapTranscript returns conn wrapped so its traffic is mirrored to t, or
+// conn unchanged if t is a no-op Transcript.
+func WrapTranscript(conn net.Conn, t *Transcript) net.Conn {
+	if t == nil || t.dir == "" {
+		return conn
+	}
+	return &transcriptConn{Conn: conn, transcript: t}
+}